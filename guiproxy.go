@@ -4,17 +4,20 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/user"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/juju/guiproxy/internal/guiconfig"
-	"github.com/juju/guiproxy/internal/juju"
-	"github.com/juju/guiproxy/server"
+	"github.com/frankban/guiproxy/internal/guiconfig"
+	"github.com/frankban/guiproxy/internal/juju"
+	"github.com/frankban/guiproxy/server"
 )
 
 // version holds the guiproxy program version.
@@ -31,12 +34,20 @@ func main() {
 	}
 	log.Printf("%s %s\n", program, version)
 	log.Println("configuring the server")
-	listenAddr := ":" + strconv.Itoa(options.port)
-	controllerAddr, err := juju.Info(options.controllerAddr)
+	listener, originAddr, err := listen(options)
+	if err != nil {
+		log.Fatalf("cannot start listening: %s", err)
+	}
+	defer listener.Close()
+	controllerAddr, err := dialJujuInfo(options.controllerAddr, options.dialOpts)
 	if err != nil {
 		log.Fatalf("cannot retrieve Juju URLs: %s", err)
 	}
-	log.Printf("GUI sandbox: %s\n", options.guiURL)
+	if options.guiArchive != "" {
+		log.Printf("GUI archive: %s\n", options.guiArchive)
+	} else {
+		log.Printf("GUI sandbox: %s\n", options.guiURL)
+	}
 	log.Printf("controller: %s\n", controllerAddr)
 	if options.legacyJuju {
 		log.Println("using Juju 1")
@@ -47,30 +58,98 @@ func main() {
 	if len(options.guiConfig) != 0 {
 		log.Println("GUI config has been customized")
 	}
+	models, err := juju.Models(controllerAddr)
+	if err != nil {
+		log.Printf("cannot retrieve the model list: %s", err)
+	}
+	modelUUID := resolveModelUUID(options.model, models)
+	if modelUUID != "" {
+		log.Printf("model: %s\n", modelUUID)
+	}
 
 	// Set up the HTTP server.
 	srv := server.New(server.Params{
-		ControllerAddr: controllerAddr,
-		OriginAddr:     "http://0.0.0.0" + listenAddr,
-		GUIURL:         options.guiURL,
-		GUIConfig:      options.guiConfig,
-		LegacyJuju:     options.legacyJuju,
-		NoColor:        options.noColor,
+		ControllerAddr:  controllerAddr,
+		ModelUUID:       modelUUID,
+		Models:          models,
+		OriginAddr:      originAddr,
+		Port:            options.port,
+		GUIURL:          options.guiURL,
+		GUIArchive:      options.guiArchive,
+		GUIConfig:       options.guiConfig,
+		LegacyJuju:      options.legacyJuju,
+		FollowRedirects: options.followRedirects,
+		DialOpts:        options.dialOpts,
+		NoColor:         options.noColor,
 	})
 
 	// Start the GUI proxy server.
 	log.Println("starting the server\n")
-	log.Printf("visit the GUI at http://0.0.0.0:%d%s\n", options.port, guiconfig.BaseURL)
-	if err := http.ListenAndServe(listenAddr, srv); err != nil {
+	if options.socket != "" {
+		log.Printf("visit the GUI at %s%s\n", originAddr, guiconfig.BaseURL)
+	} else {
+		log.Printf("visit the GUI at http://0.0.0.0:%d%s\n", options.port, guiconfig.BaseURL)
+	}
+	if err := http.Serve(listener, srv); err != nil {
 		log.Fatalf("cannot start server: %s", err)
 	}
 }
 
+// listen sets up the network listener used to serve the GUI proxy,
+// honoring the "-socket" flag when provided. It returns the listener and
+// the origin address to advertise to the GUI.
+func listen(options *config) (net.Listener, string, error) {
+	if options.socket == "" {
+		listenAddr := ":" + strconv.Itoa(options.port)
+		listener, err := net.Listen("tcp", listenAddr)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot listen on %s: %s", listenAddr, err)
+		}
+		return listener, "http://0.0.0.0" + listenAddr, nil
+	}
+	os.Remove(options.socket)
+	listener, err := net.Listen("unix", options.socket)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot listen on socket %q: %s", options.socket, err)
+	}
+	if err := os.Chmod(options.socket, options.socketMode); err != nil {
+		listener.Close()
+		return nil, "", fmt.Errorf("cannot set permissions on socket %q: %s", options.socket, err)
+	}
+	if options.socketGroup != "" {
+		if err := chownSocketGroup(options.socket, options.socketGroup); err != nil {
+			listener.Close()
+			return nil, "", err
+		}
+	}
+	log.Printf("listening on Unix domain socket %s (mode %#o)\n", options.socket, options.socketMode.Perm())
+	return listener, "http+unix://" + options.socket, nil
+}
+
+// chownSocketGroup changes the group ownership of the socket at path to
+// the named group, so that it can also be reached by other users in that
+// group.
+func chownSocketGroup(path, group string) error {
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return fmt.Errorf("cannot find group %q: %s", group, err)
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid group id %q for group %q: %s", g.Gid, group, err)
+	}
+	if err := os.Chown(path, -1, gid); err != nil {
+		return fmt.Errorf("cannot chown socket %q to group %q: %s", path, group, err)
+	}
+	return nil
+}
+
 // parseOptions returns the GUI proxy server configuration options.
 func parseOptions() (*config, error) {
 	flag.Usage = usage
 	port := flag.Int("port", defaultPort, "GUI proxy server port")
 	guiAddr := flag.String("gui", defaultGUIAddr, "address on which the GUI in sandbox mode is listening")
+	guiArchive := flag.String("gui-archive", "", "path to a juju-gui-*.tar.bz2 release tarball to serve instead of using a GUI sandbox process")
 	controllerAddr := flag.String("controller", "", `controller address (defaults to the address of the current controller), for instance:
 		-controller jimm.jujucharms.com:443`)
 	guiConfig := flag.String("config", "", `override or extend fields in the GUI configuration, for instance:
@@ -80,8 +159,31 @@ func parseOptions() (*config, error) {
 
 	envName := flag.String("env", "", "select a predefined environment to run against between the following:\n"+envChoices())
 	legacyJuju := flag.Bool("juju1", false, "connect to a Juju 1 model")
+	followRedirects := flag.Bool("follow-redirects", true, "transparently follow controller redirects (e.g. from JIMM) instead of forwarding them to the GUI")
+	dialTimeout := flag.Duration("dial-timeout", server.DefaultDialOpts.Timeout, "timeout for a single controller dial attempt")
+	dialRetry := flag.Duration("dial-retry", server.DefaultDialOpts.RetryDelay, "delay between controller dial attempts")
+	dialAttempts := flag.Int("dial-attempts", server.DefaultDialOpts.MinRetries, "number of controller dial attempts before giving up")
+	socket := flag.String("socket", "", "path to a Unix domain socket to listen on, instead of -port (restricted to the invoking user)")
+	socketMode := flag.String("socket-mode", "0600", "permission bits for the socket created with -socket")
+	socketGroup := flag.String("socket-group", "", "supplementary group allowed to access the socket created with -socket")
+	model := flag.String("model", "", "name or UUID of the model to preselect in the GUI")
 	noColor := flag.Bool("nocolor", false, "do not use colors")
 	flag.Parse()
+	if *socket != "" {
+		explicitPort := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "port" {
+				explicitPort = true
+			}
+		})
+		if explicitPort {
+			return nil, fmt.Errorf("cannot use -port and -socket together")
+		}
+	}
+	socketModeBits, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -socket-mode %q: %s", *socketMode, err)
+	}
 	if !strings.HasPrefix(*guiAddr, "http") {
 		*guiAddr = "http://" + *guiAddr
 	}
@@ -101,13 +203,24 @@ func parseOptions() (*config, error) {
 		*controllerAddr = guiconfig.Environments[*envName].ControllerAddr
 	}
 	return &config{
-		port:           *port,
-		guiURL:         guiURL,
-		controllerAddr: *controllerAddr,
-		envName:        *envName,
-		guiConfig:      overrides,
-		legacyJuju:     *legacyJuju,
-		noColor:        *noColor,
+		port:            *port,
+		guiURL:          guiURL,
+		guiArchive:      *guiArchive,
+		controllerAddr:  *controllerAddr,
+		envName:         *envName,
+		guiConfig:       overrides,
+		legacyJuju:      *legacyJuju,
+		followRedirects: *followRedirects,
+		dialOpts: server.DialOpts{
+			Timeout:    *dialTimeout,
+			RetryDelay: *dialRetry,
+			MinRetries: *dialAttempts,
+		},
+		socket:      *socket,
+		socketMode:  os.FileMode(socketModeBits),
+		socketGroup: *socketGroup,
+		model:       *model,
+		noColor:     *noColor,
 	}, nil
 }
 
@@ -118,13 +231,60 @@ const (
 
 // config holds the GUI proxy server configuration options.
 type config struct {
-	port           int
-	guiURL         *url.URL
-	controllerAddr string
-	envName        string
-	guiConfig      map[string]interface{}
-	legacyJuju     bool
-	noColor        bool
+	port            int
+	guiURL          *url.URL
+	guiArchive      string
+	controllerAddr  string
+	envName         string
+	guiConfig       map[string]interface{}
+	legacyJuju      bool
+	followRedirects bool
+	dialOpts        server.DialOpts
+	socket          string
+	socketMode      os.FileMode
+	socketGroup     string
+	model           string
+	noColor         bool
+}
+
+// resolveModelUUID returns the UUID of the model identified by name (which
+// may itself already be a UUID) among the given models. If name does not
+// match any known model, it is returned untouched, so that a UUID copied
+// directly from the Juju CLI still works even if the model list could not
+// be retrieved.
+func resolveModelUUID(name string, models []juju.Model) string {
+	if name == "" {
+		return ""
+	}
+	for _, m := range models {
+		if m.Name == name || m.UUID == name {
+			return m.UUID
+		}
+	}
+	return name
+}
+
+// dialJujuInfo retrieves the current Juju controller address, retrying
+// according to opts when the local Juju client is not yet reachable (for
+// instance because the controller is still bootstrapping).
+func dialJujuInfo(controllerAddr string, opts server.DialOpts) (string, error) {
+	attempts := opts.MinRetries
+	if attempts < 1 {
+		attempts = 1
+	}
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		addr, err := juju.Info(controllerAddr)
+		if err == nil {
+			return addr, nil
+		}
+		lastErr = err
+		log.Printf("cannot retrieve Juju URLs (attempt %d/%d): %s", attempt, attempts, err)
+		if attempt < attempts {
+			time.Sleep(opts.RetryDelay)
+		}
+	}
+	return "", lastErr
 }
 
 // usage provides the command help and usage information.
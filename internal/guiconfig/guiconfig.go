@@ -0,0 +1,54 @@
+// Package guiconfig holds logic to generate the configuration used by the
+// Juju GUI served by the proxy.
+package guiconfig
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// BaseURL holds the path at which the GUI is mounted by the proxy.
+const BaseURL = "/gui/"
+
+// Environment holds the predefined options required to run the GUI proxy
+// against a well known deployment.
+type Environment struct {
+	// ControllerAddr holds the address of the controller for this
+	// environment.
+	ControllerAddr string
+}
+
+// Environments holds predefined environments that can be selected on the
+// command line with the "-env" flag.
+var Environments = map[string]Environment{
+	"production": {
+		ControllerAddr: "jimm.jujucharms.com:443",
+	},
+	"staging": {
+		ControllerAddr: "jimm.staging.jujucharms.com:443",
+	},
+	"qa": {
+		ControllerAddr: "jimm.qa.jujucharms.com:443",
+	},
+}
+
+// ParseOverridesForEnv parses the given GUI configuration overrides,
+// provided as a YAML flow mapping body (for instance
+// `gisf: true, charmstoreURL: "https://1.2.3.4/cs"`), validating envName
+// against the predefined Environments in the process.
+func ParseOverridesForEnv(envName, overrides string) (map[string]interface{}, error) {
+	if envName != "" {
+		if _, ok := Environments[envName]; !ok {
+			return nil, fmt.Errorf("invalid environment provided: %q", envName)
+		}
+	}
+	result := make(map[string]interface{})
+	if overrides == "" {
+		return result, nil
+	}
+	if err := yaml.Unmarshal([]byte("{"+overrides+"}"), &result); err != nil {
+		return nil, fmt.Errorf("cannot parse GUI config overrides: %s", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,130 @@
+// Package juju provides helpers for retrieving information from the local
+// Juju client.
+package juju
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+)
+
+// Model holds information about a Juju model, as returned by Models.
+type Model struct {
+	// Name holds the model name.
+	Name string `json:"name"`
+	// UUID holds the model unique identifier.
+	UUID string `json:"uuid"`
+	// Owner holds the name of the model owner.
+	Owner string `json:"owner"`
+}
+
+// controllerDetails holds the subset of "juju show-controller" output used
+// to resolve a registered controller name from its API address.
+type controllerDetails struct {
+	Details struct {
+		APIEndpoints []string `json:"api-endpoints"`
+	} `json:"details"`
+}
+
+// runJuju invokes the local "juju" client with the given arguments and
+// returns its standard output. It is a variable so that tests can stub out
+// the local Juju client.
+var runJuju = func(args ...string) ([]byte, error) {
+	return exec.Command("juju", args...).Output()
+}
+
+// showControllers returns the registered Juju controllers known to the
+// local client, keyed by controller name, as reported by
+// "juju show-controller".
+func showControllers() (map[string]controllerDetails, error) {
+	out, err := runJuju("show-controller", "--format=json")
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve the registered controllers: %s", err)
+	}
+	var controllers map[string]controllerDetails
+	if err := json.Unmarshal(out, &controllers); err != nil {
+		return nil, fmt.Errorf("cannot parse controller info: %s", err)
+	}
+	return controllers, nil
+}
+
+// controllerName returns the name of the registered controller (as found
+// in controllers.yaml) whose API endpoints include addr, or "" if none
+// matches.
+func controllerName(controllers map[string]controllerDetails, addr string) string {
+	for name, controller := range controllers {
+		for _, ep := range controller.Details.APIEndpoints {
+			if ep == addr {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Models returns the models visible to the local Juju client on the
+// controller at the given address, as reported by "juju models". If
+// controllerAddr is empty, the currently active controller is used.
+// Otherwise, since the Juju CLI's "-c/--controller" flag takes a
+// registered controller name rather than a network address, controllerAddr
+// is first resolved to a name via "juju show-controller". If no registered
+// controller matches (for instance because the proxy was pointed, via
+// "-controller", at a controller the user has never locally
+// "juju switch"ed to), a warning is logged and the currently active
+// controller's models are returned instead, which may not match
+// controllerAddr.
+func Models(controllerAddr string) ([]Model, error) {
+	args := []string{"models", "--format=json"}
+	if controllerAddr != "" {
+		controllers, err := showControllers()
+		if err != nil {
+			return nil, err
+		}
+		if name := controllerName(controllers, controllerAddr); name != "" {
+			args = append(args, "-c", name)
+		} else {
+			log.Printf("warning: no registered Juju controller found for address %q; using the currently active controller, whose models may not match", controllerAddr)
+		}
+	}
+	out, err := runJuju(args...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve the model list: %s", err)
+	}
+	var result struct {
+		Models []struct {
+			Name  string `json:"name"`
+			UUID  string `json:"model-uuid"`
+			Owner string `json:"owner"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("cannot parse model list: %s", err)
+	}
+	models := make([]Model, len(result.Models))
+	for i, m := range result.Models {
+		models[i] = Model{Name: m.Name, UUID: m.UUID, Owner: m.Owner}
+	}
+	return models, nil
+}
+
+// Info returns the address of the current Juju controller, as reported by
+// "juju show-controller". If controllerAddr is already provided, it is
+// returned untouched, so that callers can override the local Juju client
+// altogether.
+func Info(controllerAddr string) (string, error) {
+	if controllerAddr != "" {
+		return controllerAddr, nil
+	}
+	controllers, err := showControllers()
+	if err != nil {
+		return "", err
+	}
+	for _, controller := range controllers {
+		if len(controller.Details.APIEndpoints) == 0 {
+			continue
+		}
+		return controller.Details.APIEndpoints[0], nil
+	}
+	return "", fmt.Errorf("no API endpoints found for the current controller")
+}
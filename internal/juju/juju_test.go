@@ -0,0 +1,135 @@
+package juju
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const showControllerOutput = `{
+	"local": {
+		"details": {
+			"api-endpoints": ["10.0.0.1:17070"]
+		}
+	},
+	"jimm": {
+		"details": {
+			"api-endpoints": ["jimm.jujucharms.com:443"]
+		}
+	}
+}`
+
+const modelsOutput = `{
+	"models": [
+		{"name": "default", "model-uuid": "uuid1", "owner": "admin"},
+		{"name": "staging", "model-uuid": "uuid2", "owner": "admin"}
+	]
+}`
+
+// stubJuju replaces runJuju with a fake dispatching on the subcommand (the
+// first argument), restoring the original once the test completes. The
+// models argument list passed to the "models" subcommand is recorded in
+// gotModelsArgs, if not nil.
+func stubJuju(t *testing.T, gotModelsArgs *[]string) {
+	t.Helper()
+	original := runJuju
+	runJuju = func(args ...string) ([]byte, error) {
+		switch args[0] {
+		case "show-controller":
+			return []byte(showControllerOutput), nil
+		case "models":
+			if gotModelsArgs != nil {
+				*gotModelsArgs = args
+			}
+			return []byte(modelsOutput), nil
+		}
+		return nil, fmt.Errorf("unexpected juju subcommand %q", args[0])
+	}
+	t.Cleanup(func() {
+		runJuju = original
+	})
+}
+
+func TestModelsNoControllerAddr(t *testing.T) {
+	var gotArgs []string
+	stubJuju(t, &gotArgs)
+
+	models, err := Models("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []Model{
+		{Name: "default", UUID: "uuid1", Owner: "admin"},
+		{Name: "staging", UUID: "uuid2", Owner: "admin"},
+	}
+	if !reflect.DeepEqual(models, want) {
+		t.Fatalf("unexpected models: got %#v, want %#v", models, want)
+	}
+	for _, a := range gotArgs {
+		if a == "-c" {
+			t.Fatalf("unexpected -c flag in args %v", gotArgs)
+		}
+	}
+}
+
+func TestModelsWithRegisteredControllerAddr(t *testing.T) {
+	var gotArgs []string
+	stubJuju(t, &gotArgs)
+
+	if _, err := Models("jimm.jujucharms.com:443"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	found := false
+	for i, a := range gotArgs {
+		if a == "-c" {
+			found = true
+			if gotArgs[i+1] != "jimm" {
+				t.Fatalf("unexpected controller name: got %q, want %q", gotArgs[i+1], "jimm")
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected a -c flag in args %v", gotArgs)
+	}
+}
+
+func TestModelsWithUnregisteredControllerAddr(t *testing.T) {
+	var gotArgs []string
+	stubJuju(t, &gotArgs)
+
+	models, err := Models("unknown.example.com:443")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("unexpected number of models: %d", len(models))
+	}
+	for _, a := range gotArgs {
+		if a == "-c" {
+			t.Fatalf("did not expect a -c flag when no controller matches, got args %v", gotArgs)
+		}
+	}
+}
+
+func TestInfoWithControllerAddr(t *testing.T) {
+	addr, err := Info("1.2.3.4:443")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if addr != "1.2.3.4:443" {
+		t.Fatalf("unexpected address: got %q, want %q", addr, "1.2.3.4:443")
+	}
+}
+
+func TestInfoFromLocalClient(t *testing.T) {
+	stubJuju(t, nil)
+
+	addr, err := Info("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "10.0.0.1:17070"
+	if addr != want && addr != "jimm.jujucharms.com:443" {
+		t.Fatalf("unexpected address: got %q", addr)
+	}
+}
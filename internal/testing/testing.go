@@ -0,0 +1,38 @@
+// Package testing holds testing utilities shared by guiproxy packages.
+package testing
+
+import (
+	"net/url"
+	"testing"
+)
+
+// MustParseURL parses the given URL string, failing the test on error.
+func MustParseURL(t *testing.T, rawurl string) *url.URL {
+	u, err := url.Parse(rawurl)
+	AssertError(t, err, nil)
+	return u
+}
+
+// AssertError checks that the given error matches the expected one.
+// If expected is nil, err must be nil too.
+func AssertError(t *testing.T, err, expected error) {
+	if expected == nil {
+		if err != nil {
+			t.Fatalf("expected no error, got %q", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("expected error %q, got none", expected)
+	}
+	if err.Error() != expected.Error() {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+}
+
+// AssertString checks that the given string matches the expected one.
+func AssertString(t *testing.T, s, expected string) {
+	if s != expected {
+		t.Fatalf("expected %q, got %q", expected, s)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestListenTCP(t *testing.T) {
+	// Reserve a free port up front, so that the test can assert on its
+	// exact value instead of an OS-assigned one.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot reserve a port: %s", err)
+	}
+	_, portStr, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatalf("cannot parse reserved address: %s", err)
+	}
+	l.Close()
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("unexpected port %q: %s", portStr, err)
+	}
+
+	options := &config{port: port}
+	listener, originAddr, err := listen(options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer listener.Close()
+
+	if _, ok := listener.(*net.TCPListener); !ok {
+		t.Fatalf("unexpected listener type: %T", listener)
+	}
+	want := "http://0.0.0.0:" + portStr
+	if originAddr != want {
+		t.Fatalf("unexpected origin address: got %q, want %q", originAddr, want)
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guiproxy-listen-test")
+	if err != nil {
+		t.Fatalf("cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "guiproxy.socket")
+
+	options := &config{
+		socket:     socket,
+		socketMode: 0600,
+	}
+	listener, originAddr, err := listen(options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer listener.Close()
+
+	if network := listener.Addr().Network(); network != "unix" {
+		t.Fatalf("unexpected listener network: got %q, want %q", network, "unix")
+	}
+	want := "http+unix://" + socket
+	if originAddr != want {
+		t.Fatalf("unexpected origin address: got %q, want %q", originAddr, want)
+	}
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("cannot stat socket file: %s", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("unexpected socket permissions: got %#o, want %#o", perm, 0600)
+	}
+}
+
+func TestListenUnixSocketBadGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guiproxy-listen-test")
+	if err != nil {
+		t.Fatalf("cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "guiproxy.socket")
+
+	options := &config{
+		socket:      socket,
+		socketMode:  0600,
+		socketGroup: "guiproxy-nonexistent-group",
+	}
+	_, _, err = listen(options)
+	if err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	if !strings.Contains(err.Error(), "cannot find group") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
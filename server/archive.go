@@ -0,0 +1,152 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frankban/guiproxy/internal/guiconfig"
+)
+
+// guiArchive holds a Juju GUI release extracted from a "juju-gui-*.tar.bz2"
+// tarball, so that it can be served without requiring a separate GUI
+// sandbox process.
+type guiArchive struct {
+	// dir holds the temporary directory in which the archive's "static/"
+	// tree has been extracted.
+	dir string
+	// version holds the GUI release version, as found in the top level
+	// "jujugui-<version>" directory of the archive.
+	version string
+}
+
+// newGUIArchive decompresses and extracts the Juju GUI release tarball at
+// the given path, returning a guiArchive ready to serve its static files.
+// The caller is responsible for calling Close on the returned value once
+// the archive is no longer needed.
+func newGUIArchive(path string) (*guiArchive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open GUI archive: %s", err)
+	}
+	defer f.Close()
+	return extractGUIArchive(bzip2.NewReader(f))
+}
+
+// extractGUIArchive extracts the "static/" tree of a Juju GUI release from
+// the uncompressed tar stream r, as produced by decompressing a
+// "juju-gui-*.tar.bz2" release tarball. It is split out from newGUIArchive
+// so that the extraction logic can be exercised with an in-memory tar
+// stream in tests, without having to produce actual bzip2-compressed data.
+func extractGUIArchive(r io.Reader) (*guiArchive, error) {
+	dir, err := ioutil.TempDir("", "guiproxy-gui-archive")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create temporary directory for GUI archive: %s", err)
+	}
+
+	a := &guiArchive{dir: dir}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("cannot read GUI archive: %s", err)
+		}
+		topDir, rest, err := splitArchivePath(hdr.Name)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		if a.version == "" {
+			version := strings.TrimPrefix(topDir, "jujugui-")
+			if version == topDir {
+				os.RemoveAll(dir)
+				return nil, fmt.Errorf("unexpected top level directory %q in GUI archive: expected \"jujugui-<version>\"", topDir)
+			}
+			a.version = version
+		}
+		if !strings.HasPrefix(rest, "static/") || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extractArchiveFile(dir, rest, tr, hdr); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	if a.version == "" {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("no jujugui-<version> directory found in GUI archive")
+	}
+	return a, nil
+}
+
+// splitArchivePath splits a tar entry name into its top level directory and
+// the remaining relative path.
+func splitArchivePath(name string) (topDir, rest string, err error) {
+	name = strings.TrimPrefix(name, "./")
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("unexpected entry %q in GUI archive", name)
+	}
+	return parts[0], parts[1], nil
+}
+
+// extractArchiveFile writes the content of the current tar entry to the
+// corresponding path under dir. It rejects entries that would escape dir
+// (for instance via ".." path segments), as tar archives are not trusted
+// to be well formed.
+func extractArchiveFile(dir, rest string, r io.Reader, hdr *tar.Header) error {
+	dst := filepath.Join(dir, filepath.FromSlash(rest))
+	if dst != dir && !strings.HasPrefix(dst, dir+string(filepath.Separator)) {
+		return fmt.Errorf("GUI archive entry %q escapes the extraction directory", rest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("cannot create GUI static directory: %s", err)
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+	if err != nil {
+		return fmt.Errorf("cannot create GUI static file %q: %s", dst, err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, r); err != nil {
+		return fmt.Errorf("cannot write GUI static file %q: %s", dst, err)
+	}
+	return nil
+}
+
+// Close removes the temporary directory used to extract the GUI archive.
+func (a *guiArchive) Close() error {
+	return os.RemoveAll(a.dir)
+}
+
+// staticDir returns the path to the extracted "static/" tree.
+func (a *guiArchive) staticDir() string {
+	return filepath.Join(a.dir, "static")
+}
+
+// Handler returns an HTTP handler serving the extracted GUI static files,
+// mounting the SPA index at guiconfig.BaseURL.
+func (a *guiArchive) Handler() http.Handler {
+	dir := a.staticDir()
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := req.URL.Path
+		if path == "/" || path == guiconfig.BaseURL {
+			path = "/index.html"
+		}
+		fullPath := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(path, "/")))
+		if ct := mime.TypeByExtension(filepath.Ext(fullPath)); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+		http.ServeFile(w, req, fullPath)
+	})
+}
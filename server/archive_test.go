@@ -0,0 +1,120 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frankban/guiproxy/internal/guiconfig"
+)
+
+// newTestTar builds an in-memory tar stream from the given entries, keyed
+// by tar entry name and holding the entry content.
+func newTestTar(t *testing.T, entries map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range entries {
+		hdr := &tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("cannot write tar header for %q: %s", name, err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("cannot write tar content for %q: %s", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("cannot close tar writer: %s", err)
+	}
+	return &buf
+}
+
+func TestExtractGUIArchive(t *testing.T) {
+	r := newTestTar(t, map[string]string{
+		"jujugui-2.9.0/static/index.html": "<html>gui</html>",
+		"jujugui-2.9.0/static/app.js":     "console.log('gui');",
+	})
+	a, err := extractGUIArchive(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer a.Close()
+	if a.version != "2.9.0" {
+		t.Fatalf("unexpected version: got %q, want %q", a.version, "2.9.0")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(a.staticDir(), "index.html"))
+	if err != nil {
+		t.Fatalf("cannot read extracted file: %s", err)
+	}
+	if string(b) != "<html>gui</html>" {
+		t.Fatalf("unexpected extracted content: %q", b)
+	}
+}
+
+func TestExtractGUIArchivePathEscape(t *testing.T) {
+	r := newTestTar(t, map[string]string{
+		"jujugui-2.9.0/static/index.html":                              "<html>gui</html>",
+		"jujugui-2.9.0/static/../../../../../../tmp/guiproxy-evil.txt": "pwned",
+	})
+	a, err := extractGUIArchive(r)
+	if err == nil {
+		a.Close()
+		t.Fatal("expected an error, got none")
+	}
+	if _, statErr := os.Stat("/tmp/guiproxy-evil.txt"); statErr == nil {
+		os.Remove("/tmp/guiproxy-evil.txt")
+		t.Fatal("archive entry escaped the extraction directory")
+	}
+}
+
+func TestGUIArchiveHandler(t *testing.T) {
+	r := newTestTar(t, map[string]string{
+		"jujugui-2.9.0/static/index.html": "<html>gui</html>",
+		"jujugui-2.9.0/static/app.js":     "console.log('gui');",
+		"jujugui-2.9.0/static/logo.svg":   "<svg></svg>",
+	})
+	a, err := extractGUIArchive(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer a.Close()
+
+	ts := httptest.NewServer(a.Handler())
+	defer ts.Close()
+
+	// The index page is served both at "/" and at the GUI base URL.
+	for _, path := range []string{"/", guiconfig.BaseURL} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("cannot GET %q: %s", path, err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("cannot read body for %q: %s", path, err)
+		}
+		if string(b) != "<html>gui</html>" {
+			t.Fatalf("unexpected body for %q: %q", path, b)
+		}
+	}
+
+	// A static file is served with the Content-Type inferred from its
+	// extension.
+	resp, err := http.Get(ts.URL + "/logo.svg")
+	if err != nil {
+		t.Fatalf("cannot GET /logo.svg: %s", err)
+	}
+	resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "image/svg+xml" {
+		t.Fatalf("unexpected Content-Type for /logo.svg: %q", ct)
+	}
+}
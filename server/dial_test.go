@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestIsRetryableDialErr(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{fmt.Errorf("dial tcp 1.2.3.4:443: connect: connection refused"), true},
+		{fmt.Errorf("timed out dialing wss://1.2.3.4:443"), true},
+		{fmt.Errorf("dial tcp: lookup foo.invalid: no such host"), true},
+		{fmt.Errorf("dial tcp 1.2.3.4:443: i/o timeout"), false},
+		{fmt.Errorf("some other error"), false},
+	}
+	for _, test := range tests {
+		if got := isRetryableDialErr(test.err); got != test.want {
+			t.Errorf("isRetryableDialErr(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+// reserveAddr binds a local TCP address and immediately releases it, so
+// that a subsequent dial against it fails with "connection refused" until
+// something else starts listening on it.
+func reserveAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot reserve an address: %s", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestDialBackendRetryThenSucceed(t *testing.T) {
+	addr := reserveAddr(t)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api", websocket.Handler(func(ws *websocket.Conn) {
+		websocket.Message.Send(ws, "ok")
+	}))
+	ts := httptest.NewUnstartedServer(mux)
+	ts.Listener.Close()
+
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		// Give dialBackend a chance to observe a connection refused
+		// error on its first attempt before the backend comes up.
+		time.Sleep(50 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("cannot bind reserved address %s: %s", addr, err)
+			return
+		}
+		ts.Listener = l
+		ts.StartTLS()
+	}()
+	defer func() {
+		<-started
+		ts.Close()
+	}()
+
+	opts := DialOpts{
+		Timeout:    2 * time.Second,
+		RetryDelay: 150 * time.Millisecond,
+		MinRetries: 5,
+	}
+	conn, err := dialBackend(addr, "/api", "http://localhost/", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	var msg string
+	if err := websocket.Message.Receive(conn, &msg); err != nil {
+		t.Fatalf("cannot read from backend: %s", err)
+	}
+	if msg != "ok" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+}
+
+func TestDialBackendRetryExhausted(t *testing.T) {
+	addr := reserveAddr(t)
+
+	opts := DialOpts{
+		Timeout:    200 * time.Millisecond,
+		RetryDelay: 10 * time.Millisecond,
+		MinRetries: 3,
+	}
+	start := time.Now()
+	_, err := dialBackend(addr, "/api", "http://localhost/", opts)
+	if err == nil {
+		t.Fatal("expected an error, got none")
+	}
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("retries took too long: %s", elapsed)
+	}
+}
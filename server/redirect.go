@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// hostPort mirrors the address information returned by the Juju API
+// "RedirectInfo" result, as used by JIMM to point the client to the
+// controller actually hosting a model.
+type hostPort struct {
+	Value string `json:"value"`
+	Type  string `json:"type"`
+	Scope string `json:"scope"`
+	Port  int    `json:"port"`
+}
+
+// rpcFrame represents a Juju RPC response frame, as read from a proxied
+// controller WebSocket connection.
+type rpcFrame struct {
+	RequestId uint64 `json:"request-id"`
+	Response  struct {
+		Servers   [][]hostPort `json:"servers"`
+		ModelUUID string       `json:"model-uuid"`
+	} `json:"response"`
+}
+
+// redirectInfo returns the host/port groups and, if present, the new model
+// UUID advertised by a controller redirect response, or nil/"" if raw does
+// not hold one.
+func redirectInfo(raw string) ([][]hostPort, string) {
+	var frame rpcFrame
+	if err := json.Unmarshal([]byte(raw), &frame); err != nil {
+		return nil, ""
+	}
+	return frame.Response.Servers, frame.Response.ModelUUID
+}
+
+// pickRedirectAddr chooses an address to dial from the host/port groups of
+// a controller redirect response, preferring public addresses over
+// cloud-local ones.
+func pickRedirectAddr(servers [][]hostPort) (string, bool) {
+	for _, scope := range []string{"public", "cloud-local"} {
+		for _, group := range servers {
+			for _, hp := range group {
+				if hp.Scope == scope {
+					return fmt.Sprintf("%s:%d", hp.Value, hp.Port), true
+				}
+			}
+		}
+	}
+	for _, group := range servers {
+		for _, hp := range group {
+			return fmt.Sprintf("%s:%d", hp.Value, hp.Port), true
+		}
+	}
+	return "", false
+}
+
+// rewriteModelUUID replaces the model UUID segment of a
+// "/model/<uuid>/api" backend path with uuid, leaving other paths (such as
+// the controller's "/api") untouched.
+func rewriteModelUUID(backendPath, uuid string) string {
+	parts := strings.Split(backendPath, "/")
+	if len(parts) == 4 && parts[1] == "model" {
+		parts[2] = uuid
+		return strings.Join(parts, "/")
+	}
+	return backendPath
+}
+
+// followRedirect relays the client's first RPC request (typically Login)
+// to backend and inspects the response for a controller redirect, as
+// returned by JIMM when the requested model lives on another controller.
+// If the response is a redirect, it dials one of the alternate addresses,
+// replays the request there, and returns the new connection in place of
+// backend (closing the original). Otherwise the original request/response
+// pair is relayed untouched and backend is returned unchanged. Either way,
+// the caller can resume plain bidirectional proxying on the returned
+// connection.
+func followRedirect(client, backend *websocket.Conn, backendPath, origin string, opts DialOpts) *websocket.Conn {
+	var reqRaw string
+	if err := websocket.Message.Receive(client, &reqRaw); err != nil {
+		return backend
+	}
+	if err := websocket.Message.Send(backend, reqRaw); err != nil {
+		log.Printf("cannot forward first request to backend: %s", err)
+		return backend
+	}
+	var respRaw string
+	if err := websocket.Message.Receive(backend, &respRaw); err != nil {
+		log.Printf("cannot read first response from backend: %s", err)
+		return backend
+	}
+	servers, modelUUID := redirectInfo(respRaw)
+	addr, ok := pickRedirectAddr(servers)
+	if !ok {
+		if err := websocket.Message.Send(client, respRaw); err != nil {
+			log.Printf("cannot forward buffered response to client: %s", err)
+		}
+		return backend
+	}
+	newPath := backendPath
+	if modelUUID != "" {
+		newPath = rewriteModelUUID(backendPath, modelUUID)
+	}
+	log.Printf("controller redirect received, dialing %s", addr)
+	newBackend, err := dialBackend(addr, newPath, origin, opts)
+	if err != nil {
+		log.Printf("cannot follow controller redirect to %s: %s", addr, err)
+		if err := websocket.Message.Send(client, respRaw); err != nil {
+			log.Printf("cannot forward buffered response to client: %s", err)
+		}
+		return backend
+	}
+	backend.Close()
+	if err := websocket.Message.Send(newBackend, reqRaw); err != nil {
+		log.Printf("cannot replay request on redirected backend: %s", err)
+		return newBackend
+	}
+	if err := websocket.Message.Receive(newBackend, &respRaw); err != nil {
+		log.Printf("cannot read response from redirected backend: %s", err)
+		return newBackend
+	}
+	if err := websocket.Message.Send(client, respRaw); err != nil {
+		log.Printf("cannot forward redirected response to client: %s", err)
+	}
+	return newBackend
+}
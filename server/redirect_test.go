@@ -0,0 +1,85 @@
+package server_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+
+	it "github.com/frankban/guiproxy/internal/testing"
+	"github.com/frankban/guiproxy/server"
+)
+
+// TestFollowRedirect exercises the path in which the controller redirects
+// the very first request, as JIMM does when the requested model lives on
+// another controller: the proxy must dial the redirect target, replay the
+// buffered request there, and keep proxying subsequent traffic on the new
+// connection.
+func TestFollowRedirect(t *testing.T) {
+	// jujuNew simulates the controller a redirect points to, behaving
+	// like a normal Juju API endpoint.
+	jujuNew := httptest.NewTLSServer(newJujuServer())
+	defer jujuNew.Close()
+	newHost, newPort, err := net.SplitHostPort(it.MustParseURL(t, jujuNew.URL).Host)
+	it.AssertError(t, err, nil)
+
+	// jujuOld simulates a controller (e.g. a JIMM front end) redirecting
+	// the first request it receives to jujuNew.
+	redirectMux := http.NewServeMux()
+	redirectMux.Handle("/api", websocket.Handler(func(ws *websocket.Conn) {
+		var raw string
+		if err := websocket.Message.Receive(ws, &raw); err != nil {
+			return
+		}
+		resp := fmt.Sprintf(
+			`{"request-id":1,"response":{"servers":[[{"value":%q,"type":"ipv4","scope":"public","port":%s}]]}}`,
+			newHost, newPort,
+		)
+		websocket.Message.Send(ws, resp)
+	}))
+	jujuOld := httptest.NewTLSServer(redirectMux)
+	defer jujuOld.Close()
+	oldURL := it.MustParseURL(t, jujuOld.URL)
+	oldParts := strings.Split(oldURL.Host, ":")
+
+	gui := httptest.NewServer(newGUIServer())
+	defer gui.Close()
+
+	ts := httptest.NewServer(server.New(server.Params{
+		ControllerAddr:  oldURL.Host,
+		OriginAddr:      "http://1.2.3.4:4242",
+		Port:            4242,
+		GUIURL:          it.MustParseURL(t, gui.URL),
+		FollowRedirects: true,
+	}))
+	defer ts.Close()
+
+	serverURL := it.MustParseURL(t, ts.URL)
+	u := *serverURL
+	u.Scheme = "ws"
+	srcPath := fmt.Sprintf("/controller/%s/%s/controller-api", oldParts[0], oldParts[1])
+	socketURL := u.String() + srcPath
+
+	ws, err := websocket.Dial(socketURL, "", "http://1.2.3.4:4242")
+	it.AssertError(t, err, nil)
+	defer ws.Close()
+
+	// The first request triggers the redirect: the proxy dials jujuNew,
+	// replays the request there, and relays its response back.
+	msg := jsonMessage{Request: "login"}
+	it.AssertError(t, websocket.JSON.Send(ws, msg), nil)
+	it.AssertError(t, websocket.JSON.Receive(ws, &msg), nil)
+	it.AssertString(t, msg.Request, "login")
+	it.AssertString(t, msg.Response, "/api")
+
+	// Subsequent traffic keeps flowing on the new, redirected connection.
+	msg = jsonMessage{Request: "watch"}
+	it.AssertError(t, websocket.JSON.Send(ws, msg), nil)
+	it.AssertError(t, websocket.JSON.Receive(ws, &msg), nil)
+	it.AssertString(t, msg.Request, "watch")
+	it.AssertString(t, msg.Response, "/api")
+}
@@ -0,0 +1,363 @@
+// Package server provides the HTTP server used to proxy requests between
+// the Juju GUI and a Juju controller.
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/frankban/guiproxy/internal/guiconfig"
+	"github.com/frankban/guiproxy/internal/juju"
+)
+
+// DialOpts holds parameters for dialing the Juju controller, used both for
+// the initial connection and for subsequent proxied WebSocket connections.
+// It mirrors the retry/backoff pattern used by Juju's own
+// api.DefaultDialOpts.
+type DialOpts struct {
+	// Timeout holds the amount of time to wait for a single dial attempt
+	// to succeed before giving up on it.
+	Timeout time.Duration
+	// RetryDelay holds the amount of time to wait between unsuccessful
+	// dial attempts.
+	RetryDelay time.Duration
+	// MinRetries holds the maximum number of dial attempts to make before
+	// giving up. At least one attempt is always made.
+	MinRetries int
+}
+
+// DefaultDialOpts holds a DialOpts suitable for a controller that might
+// still be bootstrapping or restarting: 8 attempts, 15 seconds apart, for a
+// total budget of about 2 minutes.
+var DefaultDialOpts = DialOpts{
+	Timeout:    15 * time.Second,
+	RetryDelay: 15 * time.Second,
+	MinRetries: 8,
+}
+
+// Params holds the parameters required to create a new GUI proxy server.
+type Params struct {
+	// ControllerAddr holds the default address of the Juju controller to
+	// which the GUI is proxied, used when a request does not specify one
+	// explicitly.
+	ControllerAddr string
+	// ModelUUID optionally holds the default model served by the GUI.
+	ModelUUID string
+	// Models optionally holds the models available on the controller, used
+	// to serve the "/models" endpoint so that the GUI (or a picker page)
+	// can enumerate them without the user having to know their UUIDs.
+	Models []juju.Model
+	// OriginAddr holds the address from which the proxy is serving the GUI,
+	// used to validate WebSocket origins.
+	OriginAddr string
+	// Port holds the port on which the proxy server is listening.
+	Port int
+	// GUIURL holds the address of the Juju GUI, run in sandbox mode. It is
+	// ignored when GUIArchive is provided.
+	GUIURL *url.URL
+	// GUIArchive optionally holds the path to a "juju-gui-*.tar.bz2" GUI
+	// release tarball. When provided, the proxy extracts and serves the
+	// GUI static files directly, without requiring a separate GUI sandbox
+	// process.
+	GUIArchive string
+	// GUIConfig holds overrides for the generated GUI configuration.
+	GUIConfig map[string]interface{}
+	// LegacyJuju specifies whether the proxy is run against a Juju 1 model.
+	LegacyJuju bool
+	// FollowRedirects specifies whether the proxy should transparently
+	// follow controller redirects (as returned by JIMM when a model lives
+	// on another controller) instead of forwarding them to the GUI, which
+	// cannot follow them due to the sandboxed origin.
+	FollowRedirects bool
+	// DialOpts holds the retry/backoff strategy used when dialing the
+	// controller, both for the initial connection and for reconnects on
+	// proxied WebSocket connections. The zero value means no retries.
+	DialOpts DialOpts
+	// NoColor specifies whether the proxy logs should avoid using colors.
+	NoColor bool
+}
+
+// New creates and returns a new HTTP handler proxying requests to the Juju
+// controller and to the GUI sandbox server.
+func New(p Params) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config.js", newConfigHandler(p))
+	mux.HandleFunc("/models", newModelsHandler(p))
+	mux.Handle("/controller/", newWebSocketHandler(p, parseControllerPath))
+	mux.Handle("/model/", newWebSocketHandler(p, parseModelPath))
+	mux.HandleFunc("/juju-core/", newHTTPSHandler(p))
+	mux.Handle("/", newGUIHandler(p))
+	return mux
+}
+
+// newGUIHandler returns an HTTP handler serving the Juju GUI, either
+// proxying to a sandbox GUI process, or, when Params.GUIArchive is set,
+// serving the GUI static files extracted from the given release tarball.
+func newGUIHandler(p Params) http.Handler {
+	if p.GUIArchive == "" {
+		return httputil.NewSingleHostReverseProxy(p.GUIURL)
+	}
+	archive, err := newGUIArchive(p.GUIArchive)
+	if err != nil {
+		log.Fatalf("cannot extract GUI archive: %s", err)
+	}
+	log.Printf("serving Juju GUI %s from %s", archive.version, p.GUIArchive)
+	cleanup := make(chan os.Signal, 1)
+	signal.Notify(cleanup, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-cleanup
+		archive.Close()
+		os.Exit(0)
+	}()
+	return archive.Handler()
+}
+
+// ConfigTemplate is the template used to generate the GUI configuration
+// file served at "/config.js".
+var ConfigTemplate = template.Must(template.New("config").Parse(`
+var juju_config = {
+    consoleEnabled: false,
+    baseUrl: "` + guiconfig.BaseURL + `",
+    jujuCoreVersion: "2.0.0",
+    jujuEnvUUID: "{{.uuid}}",
+    apiAddress: "{{.addr}}",
+    socketPostfix: "/api",
+    socket_protocol: "ws",
+    controllerSocketTemplate: "/controller/$server/$port/controller-api",
+    uuid: "{{.uuid}}",
+    socketTemplate: "/model/$server/$port/$uuid/model-api",
+    baseAddressPort: {{.port}},
+};
+`))
+
+// newConfigHandler returns an HTTP handler serializing the GUI
+// configuration, including the overrides provided in Params.GUIConfig.
+func newConfigHandler(p Params) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		data := map[string]interface{}{
+			"addr": p.ControllerAddr,
+			"port": p.Port,
+			"uuid": p.ModelUUID,
+		}
+		for k, v := range p.GUIConfig {
+			data[k] = v
+		}
+		w.Header().Set("Content-Type", "application/javascript")
+		if err := ConfigTemplate.Execute(w, data); err != nil {
+			log.Printf("cannot generate GUI config: %s", err)
+			http.Error(w, "cannot generate GUI config", http.StatusInternalServerError)
+		}
+	}
+}
+
+// newModelsHandler returns an HTTP handler serializing, as JSON, the list
+// of models available on the controller.
+func newModelsHandler(p Params) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(p.Models); err != nil {
+			log.Printf("cannot serialize model list: %s", err)
+			http.Error(w, "cannot serialize model list", http.StatusInternalServerError)
+		}
+	}
+}
+
+// pathParser parses the path of an incoming request, returning the address
+// of the Juju endpoint to which the request must be proxied, and the path
+// to use on the backend side.
+type pathParser func(p Params, path string) (addr, backendPath string, err error)
+
+// parseControllerPath parses paths in the form
+// "/controller/<host>/<port>/controller-api", proxying to the controller
+// API endpoint at <host>:<port>.
+func parseControllerPath(p Params, path string) (addr, backendPath string, err error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/controller/"), "/")
+	if len(parts) != 3 || parts[2] != "controller-api" {
+		return "", "", fmt.Errorf("invalid controller path %q", path)
+	}
+	return parts[0] + ":" + parts[1], "/api", nil
+}
+
+// parseModelPath parses paths in the form
+// "/model/<host>/<port>/<uuid>/model-api", proxying to the model API
+// endpoint for the given model at <host>:<port>.
+func parseModelPath(p Params, path string) (addr, backendPath string, err error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/model/"), "/")
+	if len(parts) != 4 || parts[3] != "model-api" {
+		return "", "", fmt.Errorf("invalid model path %q", path)
+	}
+	return parts[0] + ":" + parts[1], "/model/" + parts[2] + "/api", nil
+}
+
+// newWebSocketHandler returns an HTTP handler proxying WebSocket
+// connections to the Juju controller, using parse to translate the
+// incoming request path into a backend address and path. The handshake is
+// rejected for requests whose Origin does not match Params.OriginAddr.
+func newWebSocketHandler(p Params, parse pathParser) http.Handler {
+	return &websocket.Server{
+		Handshake: checkOrigin(p.OriginAddr),
+		Handler: func(client *websocket.Conn) {
+			req := client.Request()
+			addr, backendPath, err := parse(p, req.URL.Path)
+			if err != nil {
+				log.Printf("cannot proxy WebSocket request: %s", err)
+				client.Close()
+				return
+			}
+			backend, err := dialBackend(addr, backendPath, req.URL.String(), p.DialOpts)
+			if err != nil {
+				log.Printf("cannot dial backend WebSocket for %s: %s", addr, err)
+				client.Close()
+				return
+			}
+			if p.FollowRedirects {
+				backend = followRedirect(client, backend, backendPath, req.URL.String(), p.DialOpts)
+			}
+			defer backend.Close()
+			proxyConns(client, backend)
+		},
+	}
+}
+
+// checkOrigin returns a WebSocket handshake check rejecting requests whose
+// Origin header does not match originAddr, the address from which the GUI
+// is being served. When originAddr uses the "http+unix" scheme the proxy is
+// only reachable through a Unix domain socket, access to which is already
+// restricted by filesystem permissions (see the "-socket" flag), and the
+// Origin actually presented by a browser depends on whatever fronts that
+// socket; in that case the Origin header is not checked.
+func checkOrigin(originAddr string) func(*websocket.Config, *http.Request) error {
+	return func(config *websocket.Config, req *http.Request) error {
+		if strings.HasPrefix(originAddr, "http+unix://") {
+			return nil
+		}
+		origin := req.Header.Get("Origin")
+		if origin != "" && origin != originAddr {
+			return fmt.Errorf("invalid WebSocket origin %q: expected %q", origin, originAddr)
+		}
+		return nil
+	}
+}
+
+// dialBackend dials the Juju API WebSocket at addr/backendPath, as seen
+// from origin, retrying on transient connection errors according to opts.
+func dialBackend(addr, backendPath, origin string, opts DialOpts) (*websocket.Conn, error) {
+	backendURL := fmt.Sprintf("wss://%s%s", addr, backendPath)
+	config, err := websocket.NewConfig(backendURL, origin)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create WebSocket config for %s: %s", backendURL, err)
+	}
+	config.TlsConfig = &tls.Config{InsecureSkipVerify: true}
+	attempts := opts.MinRetries
+	if attempts < 1 {
+		attempts = 1
+	}
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		conn, err := dialWithTimeout(config, opts.Timeout)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if !isRetryableDialErr(err) {
+			return nil, err
+		}
+		log.Printf("cannot dial backend WebSocket %s (attempt %d/%d): %s", backendURL, attempt, attempts, err)
+		if attempt < attempts {
+			time.Sleep(opts.RetryDelay)
+		}
+	}
+	return nil, lastErr
+}
+
+// dialWithTimeout dials the WebSocket described by config, giving up after
+// timeout elapses. A zero timeout means no limit.
+func dialWithTimeout(config *websocket.Config, timeout time.Duration) (*websocket.Conn, error) {
+	if timeout <= 0 {
+		return websocket.DialConfig(config)
+	}
+	type result struct {
+		conn *websocket.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := websocket.DialConfig(config)
+		ch <- result{conn, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.conn, r.err
+	case <-time.After(timeout):
+		// The dial is still in flight: close the connection if it
+		// eventually succeeds, so it is not leaked once this call has
+		// already given up on it.
+		go func() {
+			if r := <-ch; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out dialing %s", config.Location)
+	}
+}
+
+// isRetryableDialErr reports whether a dial error is likely transient, for
+// instance because the controller is still bootstrapping or has just been
+// restarted.
+func isRetryableDialErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == io.EOF {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "timed out") ||
+		strings.Contains(msg, "no such host")
+}
+
+// proxyConns copies messages in both directions between the client and the
+// backend WebSocket connections, until either side is closed.
+func proxyConns(client, backend *websocket.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src *websocket.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go cp(backend, client)
+	go cp(client, backend)
+	<-done
+}
+
+// newHTTPSHandler returns an HTTP handler proxying HTTPS requests to the
+// Juju controller, used for instance to retrieve charm icons or other
+// Juju API HTTP endpoints.
+func newHTTPSHandler(p Params) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		target := &url.URL{
+			Scheme: "https",
+			Host:   p.ControllerAddr,
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/juju-core")
+		proxy.ServeHTTP(w, req)
+	}
+}
@@ -28,11 +28,12 @@ func TestNew(t *testing.T) {
 	jujuURL := it.MustParseURL(t, juju.URL)
 	jujuParts := strings.Split(jujuURL.Host, ":")
 	ts := httptest.NewServer(server.New(server.Params{
-		ControllerAddr: jujuURL.Host,
-		ModelUUID:      "example-uuid",
-		OriginAddr:     "http://1.2.3.4:4242",
-		Port:           4242,
-		GUIURL:         it.MustParseURL(t, gui.URL),
+		ControllerAddr:  jujuURL.Host,
+		ModelUUID:       "example-uuid",
+		OriginAddr:      "http://1.2.3.4:4242",
+		Port:            4242,
+		GUIURL:          it.MustParseURL(t, gui.URL),
+		FollowRedirects: true,
 	}))
 	defer ts.Close()
 
@@ -44,13 +45,14 @@ func TestNew(t *testing.T) {
 	t.Run("testJujuWebSocketController", testJujuWebSocket(serverURL, "/api", controllerPath))
 	t.Run("testJujuWebSocketModel1", testJujuWebSocket(serverURL, "/model/uuid/api", modelPath1))
 	t.Run("testJujuWebSocketModel2", testJujuWebSocket(serverURL, "/model/another-uuid/api", modelPath2))
+	t.Run("testJujuWebSocketBadOrigin", testJujuWebSocketBadOrigin(serverURL, controllerPath))
 	t.Run("testJujuHTTPS", testJujuHTTPS(serverURL))
 	t.Run("testGUIConfig", testGUIConfig(serverURL, jujuURL))
 	t.Run("testGUIStaticFiles", testGUIStaticFiles(serverURL))
 }
 
 func testJujuWebSocket(serverURL *url.URL, dstPath, srcPath string) func(t *testing.T) {
-	origin := "http://localhost/"
+	origin := "http://1.2.3.4:4242"
 	u := *serverURL
 	u.Scheme = "ws"
 	socketURL := u.String() + srcPath
@@ -73,6 +75,20 @@ func testJujuWebSocket(serverURL *url.URL, dstPath, srcPath string) func(t *test
 	}
 }
 
+func testJujuWebSocketBadOrigin(serverURL *url.URL, srcPath string) func(t *testing.T) {
+	u := *serverURL
+	u.Scheme = "ws"
+	socketURL := u.String() + srcPath
+	return func(t *testing.T) {
+		// Connecting with an Origin that does not match the proxy's
+		// OriginAddr is rejected during the WebSocket handshake.
+		_, err := websocket.Dial(socketURL, "", "http://evil.example.com/")
+		if err == nil {
+			t.Fatal("expected the handshake to fail, got no error")
+		}
+	}
+}
+
 func testJujuHTTPS(serverURL *url.URL) func(t *testing.T) {
 	return func(t *testing.T) {
 		// Make the HTTP request to retrieve a Juju HTTPS API endpoint.